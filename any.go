@@ -0,0 +1,76 @@
+package newdns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// writeAnyResponse answers a dns.TypeANY query according to the server's
+// configured ANYMode.
+func (s *Server) writeAnyResponse(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zone, name string) {
+	switch s.config.ANYMode {
+	case ANYRefuse:
+		s.writeError(w, rs, dns.RcodeNotImplemented)
+	case ANYFull:
+		s.writeAnyFull(w, rq, rs, zone, name)
+	default:
+		s.writeAnyMinimal(w, rq, rs, zone, name)
+	}
+}
+
+// writeAnyMinimal answers with a single synthesized HINFO record per
+// RFC 8482 plus the zone's NS records, avoiding a full type enumeration.
+func (s *Server) writeAnyMinimal(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zone, name string) {
+	rs.Answer = append(rs.Answer, &dns.HINFO{
+		Hdr: dns.RR_Header{
+			Name:   rq.Question[0].Name,
+			Rrtype: dns.TypeHINFO,
+			Class:  dns.ClassINET,
+			Ttl:    durationToTime(zone.MinTTL),
+		},
+		Cpu: "RFC8482",
+		Os:  "",
+	})
+
+	for _, ns := range zone.AllNameServers {
+		rs.Ns = append(rs.Ns, &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   zone.Name,
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    durationToTime(zone.NSTTL),
+			},
+			Ns: ns,
+		})
+	}
+
+	s.writeMessage(w, rq, rs, zone)
+}
+
+// writeAnyFull enumerates every type newdns understands for name and
+// returns whatever records are found, matching legacy pre-RFC 8482
+// behavior.
+func (s *Server) writeAnyFull(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zone, name string) {
+	for _, typ := range probeTypes {
+		result, _, err := zone.Lookup(name, typ)
+		if err != nil {
+			s.writeError(w, rs, dns.RcodeServerFailure)
+			s.reportError(rq, err.Error())
+			return
+		}
+
+		for _, res := range result {
+			if res.Set.Type.modern() {
+				rs.Answer = append(rs.Answer, res.Set.convertModern(transferCase(rq.Question[0].Name, res.Name))...)
+			} else {
+				rs.Answer = append(rs.Answer, res.Set.convert(zone, transferCase(rq.Question[0].Name, res.Name))...)
+			}
+		}
+	}
+
+	if len(rs.Answer) == 0 {
+		s.writeErrorWithSOA(w, rq, rs, zone, dns.RcodeNameError)
+		return
+	}
+
+	s.writeMessage(w, rq, rs, zone)
+}
@@ -0,0 +1,517 @@
+package newdns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DenialMode determines the mechanism used to prove the non-existence of a
+// name or type.
+type DenialMode int
+
+// The available denial of existence mechanisms.
+const (
+	// DenialNSEC uses plain NSEC records (RFC 4034).
+	DenialNSEC DenialMode = iota
+
+	// DenialNSEC3 uses hashed NSEC3 records (RFC 5155).
+	DenialNSEC3
+)
+
+// DNSSECKey describes a key used to sign zone data online.
+type DNSSECKey struct {
+	// The signer backing the private key material.
+	Signer crypto.Signer
+
+	// The DNSSEC algorithm number as registered with IANA e.g.
+	// dns.RSASHA256 or dns.ECDSAP256SHA256.
+	Algorithm uint8
+
+	// The key tag as computed from the public key.
+	KeyTag uint16
+
+	// Whether this is a Key Signing Key. KSKs sign the DNSKEY RRset while
+	// ZSKs sign all other RRsets.
+	KSK bool
+}
+
+// DNSKEY returns the DNSKEY record for this key that should be published in
+// the zone.
+func (k DNSSECKey) DNSKEY(zone string) *dns.DNSKEY {
+	// determine flags
+	flags := uint16(256)
+	if k.KSK {
+		flags = 257
+	}
+
+	return &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+		},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: k.Algorithm,
+		PublicKey: publicKeyString(k),
+	}
+}
+
+// DS returns the DS record that should be handed to the parent zone to
+// establish a chain of trust. It is only meaningful for KSKs.
+func (k DNSSECKey) DS(zone string) *dns.DS {
+	dnskey := k.DNSKEY(zone)
+	ds := dnskey.ToDS(dns.SHA256)
+	if ds != nil {
+		ds.Hdr.Name = zone
+	}
+
+	return ds
+}
+
+// publicKeyString renders the public key of the signer in the base64 form
+// expected inside a DNSKEY record, per the wire format mandated by the key
+// algorithm (RFC 3110 for RSA, RFC 6605 for ECDSA, RFC 8080 for EdDSA).
+func publicKeyString(k DNSSECKey) string {
+	if k.Signer == nil {
+		return ""
+	}
+
+	switch pub := k.Signer.Public().(type) {
+	case ed25519.PublicKey:
+		return base64.StdEncoding.EncodeToString(pub)
+	case *ecdsa.PublicKey:
+		// the key is the concatenation of the big-endian, zero-padded X and Y
+		// coordinates, without the 0x04 uncompressed-point prefix
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		buf := make([]byte, 2*size)
+		pub.X.FillBytes(buf[:size])
+		pub.Y.FillBytes(buf[size:])
+		return base64.StdEncoding.EncodeToString(buf)
+	case *rsa.PublicKey:
+		return base64.StdEncoding.EncodeToString(rsaWireFormat(pub))
+	default:
+		return ""
+	}
+}
+
+// rsaWireFormat renders an RSA public key as exponent-length, exponent and
+// modulus, per RFC 3110.
+func rsaWireFormat(pub *rsa.PublicKey) []byte {
+	exponent := big.NewInt(int64(pub.E)).Bytes()
+	modulus := pub.N.Bytes()
+
+	var buf []byte
+	if len(exponent) < 256 {
+		buf = append(buf, byte(len(exponent)))
+	} else {
+		buf = append(buf, 0)
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(exponent)))
+		buf = append(buf, length...)
+	}
+
+	buf = append(buf, exponent...)
+	buf = append(buf, modulus...)
+
+	return buf
+}
+
+// signatureCache is an LRU cache of freshly computed RRSIG records, keyed by
+// a hash of the signed RRset, so unchanged data is not re-signed on every
+// query. Once full, it evicts the least recently used entry rather than the
+// least recently inserted one, so a frequently re-signed RRset (e.g. the
+// apex SOA/NS/DNSKEY set) stays cached however many other RRsets are signed
+// in between.
+type signatureCache struct {
+	mutex   sync.Mutex
+	entries map[[32]byte]*cacheEntry
+	order   []([32]byte)
+	max     int
+}
+
+type cacheEntry struct {
+	rrsig *dns.RRSIG
+}
+
+// newSignatureCache creates a cache that holds at most max entries, evicting
+// the least recently used entry once full.
+func newSignatureCache(max int) *signatureCache {
+	return &signatureCache{
+		entries: make(map[[32]byte]*cacheEntry),
+		max:     max,
+	}
+}
+
+func (c *signatureCache) get(key [32]byte) *dns.RRSIG {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	// mark as most recently used
+	c.touch(key)
+
+	return entry.rrsig
+}
+
+func (c *signatureCache) put(key [32]byte, rrsig *dns.RRSIG) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[key] = &cacheEntry{rrsig: rrsig}
+	c.touch(key)
+
+	if len(c.order) > c.max {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		delete(c.entries, oldest)
+	}
+}
+
+// touch moves key to the back of order, the most recently used end, adding
+// it if not already present.
+func (c *signatureCache) touch(key [32]byte) {
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+
+	c.order = append(c.order, key)
+}
+
+// rrsetKey computes a stable hash over an RRset's owner, type and rdata so
+// the signature cache can detect unchanged data.
+func rrsetKey(rrs []dns.RR) [32]byte {
+	// sort a copy by wire presentation for a stable hash
+	sorted := make([]string, len(rrs))
+	for i, rr := range rrs {
+		sorted[i] = rr.String()
+	}
+
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, s := range sorted {
+		_, _ = h.Write([]byte(s))
+	}
+
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+
+	return sum
+}
+
+// zsk returns the first Zone Signing Key configured for the zone, if any.
+func (z *Zone) zsk() *DNSSECKey {
+	for i, key := range z.DNSSECKeys {
+		if !key.KSK {
+			return &z.DNSSECKeys[i]
+		}
+	}
+
+	return nil
+}
+
+// ksk returns the first Key Signing Key configured for the zone, if any.
+func (z *Zone) ksk() *DNSSECKey {
+	for i, key := range z.DNSSECKeys {
+		if key.KSK {
+			return &z.DNSSECKeys[i]
+		}
+	}
+
+	return nil
+}
+
+// signRRset signs the given RRset (all records must share owner and type)
+// using the zone's ZSK (or KSK for a DNSKEY RRset), returning the RRSIG to
+// append to the response. It returns nil if the zone has no usable key.
+func (s *Server) signRRset(zone *Zone, rrs []dns.RR) *dns.RRSIG {
+	if len(rrs) == 0 {
+		return nil
+	}
+
+	key := zone.zsk()
+	if rrs[0].Header().Rrtype == dns.TypeDNSKEY {
+		if k := zone.ksk(); k != nil {
+			key = k
+		}
+	}
+
+	if key == nil || key.Signer == nil {
+		return nil
+	}
+
+	if s.sigCache == nil {
+		s.sigCache = newSignatureCache(10000)
+	}
+
+	cacheKey := rrsetKey(rrs)
+	if cached := s.sigCache.get(cacheKey); cached != nil {
+		return cached
+	}
+
+	now := time.Now()
+
+	rrsig := &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Name:   rrs[0].Header().Name,
+			Rrtype: dns.TypeRRSIG,
+			Class:  dns.ClassINET,
+			Ttl:    rrs[0].Header().Ttl,
+		},
+		TypeCovered: rrs[0].Header().Rrtype,
+		Algorithm:   key.Algorithm,
+		Labels:      uint8(dns.CountLabel(rrs[0].Header().Name)),
+		OrigTtl:     rrs[0].Header().Ttl,
+		Expiration:  uint32(now.Add(zone.SignatureValidity).Unix()),
+		Inception:   uint32(now.Add(-1 * time.Hour).Unix()),
+		KeyTag:      key.KeyTag,
+		SignerName:  zone.Name,
+	}
+
+	err := rrsig.Sign(key.Signer, rrs)
+	if err != nil {
+		return nil
+	}
+
+	s.sigCache.put(cacheKey, rrsig)
+
+	return rrsig
+}
+
+// signSection groups the records of a message section into RRsets by owner
+// and type, signs each RRset and appends the resulting RRSIG records to the
+// section.
+func (s *Server) signSection(zone *Zone, rrs []dns.RR) []dns.RR {
+	groups := map[string][]dns.RR{}
+	var order []string
+
+	for _, rr := range rrs {
+		key := rr.Header().Name + "/" + dns.TypeToString[rr.Header().Rrtype]
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+
+		groups[key] = append(groups[key], rr)
+	}
+
+	out := append([]dns.RR{}, rrs...)
+
+	for _, key := range order {
+		rrsig := s.signRRset(zone, groups[key])
+		if rrsig != nil {
+			out = append(out, rrsig)
+		}
+	}
+
+	return out
+}
+
+// signMessage signs the answer, authority and additional sections of a
+// response if the client requested DNSSEC data via the EDNS0 DO bit and the
+// zone has signing keys configured.
+func (s *Server) signMessage(rq, rs *dns.Msg, zone *Zone) {
+	if len(zone.DNSSECKeys) == 0 {
+		return
+	}
+
+	edns := rq.IsEdns0()
+	if edns == nil || !edns.Do() {
+		return
+	}
+
+	rs.Answer = s.signSection(zone, rs.Answer)
+	rs.Ns = s.signSection(zone, rs.Ns)
+	rs.Extra = s.signSection(zone, rs.Extra)
+}
+
+// denialRecords synthesizes the NSEC or NSEC3 records (and their RRSIGs)
+// needed to prove that qname (or the requested type at qname) does not
+// exist, per the zone's configured DenialOfExistence mode. Per RFC 4035
+// 3.1.3, it also covers the wildcard source of synthesis for qname's parent
+// so a validating resolver can rule out a wildcard match, not just an exact
+// one. Requires Zone.Enumerate to know the zone's other owner names; without
+// it, no record can actually cover qname, so nothing is returned.
+func (s *Server) denialRecords(zone *Zone, qname string, covered []uint16) []dns.RR {
+	if len(zone.DNSSECKeys) == 0 || zone.Enumerate == nil {
+		return nil
+	}
+
+	sets, err := zone.Enumerate()
+	if err != nil {
+		return nil
+	}
+
+	names := ownerNames(sets)
+	if len(names) == 0 {
+		return nil
+	}
+
+	rrs := s.denialRecord(zone, names, qname, covered)
+
+	if wildcard := wildcardSourceOfSynthesis(zone, qname); wildcard != "" {
+		rrs = append(rrs, s.denialRecord(zone, names, wildcard, nil)...)
+	}
+
+	return rrs
+}
+
+// denialRecord synthesizes the single NSEC or NSEC3 record (and its RRSIG)
+// that covers name, i.e. whose owner precedes name and whose NextDomain
+// follows it in canonical order, per the zone's configured
+// DenialOfExistence mode.
+func (s *Server) denialRecord(zone *Zone, names []string, name string, covered []uint16) []dns.RR {
+	bitmap := make([]uint16, len(covered))
+	copy(bitmap, covered)
+	bitmap = append(bitmap, dns.TypeRRSIG, dns.TypeNSEC)
+
+	var rr dns.RR
+
+	switch zone.DenialOfExistence {
+	case DenialNSEC3:
+		hashed := dns.HashName(name, dns.SHA1, zone.NSEC3Iterations, zone.NSEC3Salt)
+
+		rr = &dns.NSEC3{
+			Hdr: dns.RR_Header{
+				Name:   hashed + "." + zone.Name,
+				Rrtype: dns.TypeNSEC3,
+				Class:  dns.ClassINET,
+				Ttl:    durationToTime(zone.MinTTL),
+			},
+			Hash:       dns.SHA1,
+			Flags:      0,
+			Iterations: zone.NSEC3Iterations,
+			SaltLength: uint8(len(zone.NSEC3Salt) / 2),
+			Salt:       zone.NSEC3Salt,
+			HashLength: sha1.Size,
+			NextDomain: nextHashedOwner(zone, names, hashed),
+			TypeBitMap: bitmap,
+		}
+	default:
+		rr = &dns.NSEC{
+			Hdr: dns.RR_Header{
+				Name:   name,
+				Rrtype: dns.TypeNSEC,
+				Class:  dns.ClassINET,
+				Ttl:    durationToTime(zone.MinTTL),
+			},
+			NextDomain: nextOwner(names, name),
+			TypeBitMap: bitmap,
+		}
+	}
+
+	rrs := []dns.RR{rr}
+
+	if rrsig := s.signRRset(zone, rrs); rrsig != nil {
+		rrs = append(rrs, rrsig)
+	}
+
+	return rrs
+}
+
+// wildcardSourceOfSynthesis returns the wildcard name ("*." plus qname's
+// immediate parent) that could have synthesized an answer for qname, or ""
+// if qname is the zone apex or already a wildcard itself.
+func wildcardSourceOfSynthesis(zone *Zone, qname string) string {
+	if qname == zone.Name {
+		return ""
+	}
+
+	idx := strings.Index(qname, ".")
+	if idx < 0 {
+		return ""
+	}
+
+	wildcard := "*." + qname[idx+1:]
+	if wildcard == qname {
+		return ""
+	}
+
+	return wildcard
+}
+
+// ownerNames collects the distinct, canonically sorted owner names found in
+// sets, as returned by Zone.Enumerate.
+func ownerNames(sets []Set) []string {
+	seen := make(map[string]bool, len(sets))
+	names := make([]string, 0, len(sets))
+
+	for _, set := range sets {
+		if !seen[set.Name] {
+			seen[set.Name] = true
+			names = append(names, set.Name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return canonicalKey(names[i]) < canonicalKey(names[j])
+	})
+
+	return names
+}
+
+// canonicalKey renders name with its labels reversed so that lexicographic
+// comparison approximates RFC 4034 canonical DNS name ordering.
+func canonicalKey(name string) string {
+	labels := dns.SplitDomainName(name)
+
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	return strings.ToLower(strings.Join(labels, "."))
+}
+
+// nextOwner returns the first name in names that canonically follows name,
+// wrapping around to the first name if name sorts after all of them.
+func nextOwner(names []string, name string) string {
+	key := canonicalKey(name)
+
+	for _, n := range names {
+		if canonicalKey(n) > key {
+			return n
+		}
+	}
+
+	return names[0]
+}
+
+// nextHashedOwner hashes every name the same way as hashed and returns the
+// first hash that follows it, wrapping around to the lowest hash if hashed
+// sorts after all of them.
+func nextHashedOwner(zone *Zone, names []string, hashed string) string {
+	hashes := make([]string, len(names))
+	for i, n := range names {
+		hashes[i] = dns.HashName(n, dns.SHA1, zone.NSEC3Iterations, zone.NSEC3Salt)
+	}
+
+	sort.Strings(hashes)
+
+	for _, h := range hashes {
+		if h > hashed {
+			return h
+		}
+	}
+
+	return hashes[0]
+}
@@ -0,0 +1,158 @@
+package newdns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCanonicalKeyOrdering(t *testing.T) {
+	names := []string{
+		"z.a.example.com.",
+		"example.com.",
+		"b.example.com.",
+		"a.example.com.",
+	}
+
+	sortedNames := append([]string{}, names...)
+	for i := 0; i < len(sortedNames); i++ {
+		for j := i + 1; j < len(sortedNames); j++ {
+			if canonicalKey(sortedNames[j]) < canonicalKey(sortedNames[i]) {
+				sortedNames[i], sortedNames[j] = sortedNames[j], sortedNames[i]
+			}
+		}
+	}
+
+	expected := []string{
+		"example.com.",
+		"a.example.com.",
+		"z.a.example.com.",
+		"b.example.com.",
+	}
+
+	if strings.Join(sortedNames, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected canonical order %v, got %v", expected, sortedNames)
+	}
+}
+
+func TestNextOwner(t *testing.T) {
+	names := []string{
+		"example.com.",
+		"a.example.com.",
+		"m.example.com.",
+		"z.example.com.",
+	}
+
+	table := []struct {
+		name     string
+		expected string
+	}{
+		{"example.com.", "a.example.com."},
+		{"b.example.com.", "m.example.com."},
+		{"z.example.com.", "example.com."}, // wraps around past the last name
+	}
+
+	for _, entry := range table {
+		next := nextOwner(names, entry.name)
+		if next != entry.expected {
+			t.Errorf("nextOwner(%q) = %q, expected %q", entry.name, next, entry.expected)
+		}
+	}
+}
+
+func TestNextHashedOwner(t *testing.T) {
+	zone := &Zone{Name: "example.com.", NSEC3Iterations: 0}
+
+	names := []string{
+		"example.com.",
+		"a.example.com.",
+		"m.example.com.",
+		"z.example.com.",
+	}
+
+	hashes := make([]string, len(names))
+	for i, n := range names {
+		hashes[i] = dns.HashName(n, dns.SHA1, zone.NSEC3Iterations, zone.NSEC3Salt)
+	}
+
+	sorted := append([]string{}, hashes...)
+	for i := 0; i < len(sorted); i++ {
+		for j := i + 1; j < len(sorted); j++ {
+			if sorted[j] < sorted[i] {
+				sorted[i], sorted[j] = sorted[j], sorted[i]
+			}
+		}
+	}
+
+	// the hash of the lowest-sorting name should return the next hash up
+	var lowest string
+	for _, n := range names {
+		h := dns.HashName(n, dns.SHA1, zone.NSEC3Iterations, zone.NSEC3Salt)
+		if h == sorted[0] {
+			lowest = n
+			break
+		}
+	}
+
+	next := nextHashedOwner(zone, names, dns.HashName(lowest, dns.SHA1, zone.NSEC3Iterations, zone.NSEC3Salt))
+	if next != sorted[1] {
+		t.Errorf("nextHashedOwner(lowest) = %q, expected next hash %q", next, sorted[1])
+	}
+
+	// a sentinel hash that sorts after every real hash must wrap around to
+	// the lowest one
+	sentinel := strings.Repeat("z", 32)
+	if sentinel <= sorted[len(sorted)-1] {
+		t.Fatalf("test sentinel does not sort after all hashes, fix the test")
+	}
+
+	wrapped := nextHashedOwner(zone, names, sentinel)
+	if wrapped != sorted[0] {
+		t.Errorf("nextHashedOwner(sentinel) = %q, expected wraparound to lowest hash %q", wrapped, sorted[0])
+	}
+}
+
+func TestWildcardSourceOfSynthesis(t *testing.T) {
+	zone := &Zone{Name: "example.com."}
+
+	table := []struct {
+		qname    string
+		expected string
+	}{
+		{"example.com.", ""}, // apex has no wildcard source
+		{"www.example.com.", "*.example.com."},
+		{"a.b.example.com.", "*.b.example.com."},
+		{"*.example.com.", ""}, // already a wildcard, not synthesized from one
+	}
+
+	for _, entry := range table {
+		got := wildcardSourceOfSynthesis(zone, entry.qname)
+		if got != entry.expected {
+			t.Errorf("wildcardSourceOfSynthesis(%q) = %q, expected %q", entry.qname, got, entry.expected)
+		}
+	}
+}
+
+func TestOwnerNames(t *testing.T) {
+	sets := []Set{
+		{Name: "z.a.example.com."},
+		{Name: "example.com."},
+		{Name: "b.example.com."},
+		{Name: "example.com."}, // duplicate, must appear only once
+		{Name: "a.example.com."},
+	}
+
+	names := ownerNames(sets)
+
+	expected := []string{
+		"example.com.",
+		"a.example.com.",
+		"z.a.example.com.",
+		"b.example.com.",
+	}
+
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected owner names %v, got %v", expected, names)
+	}
+}
@@ -0,0 +1,112 @@
+package newdns
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// LookupContext carries per-request information that a Zone.HandlerEx
+// implementation can use to tailor its answer, most notably the EDNS0
+// Client Subnet (RFC 7871) advertised by the requesting resolver.
+type LookupContext struct {
+	// Whether the request carried an EDNS0 Client Subnet option.
+	ClientSubnet bool
+
+	// The address family of the advertised subnet (1 for IPv4, 2 for IPv6).
+	Family uint16
+
+	// The number of significant bits of the client network advertised by
+	// the requesting resolver.
+	SourcePrefix uint8
+
+	// The client network, truncated to SourcePrefix bits.
+	Address net.IP
+}
+
+// extractLookupContext parses the EDNS0 Client Subnet option out of a
+// request, if present.
+func extractLookupContext(rq *dns.Msg) LookupContext {
+	edns := rq.IsEdns0()
+	if edns == nil {
+		return LookupContext{}
+	}
+
+	for _, opt := range edns.Option {
+		subnet, ok := opt.(*dns.EDNS0_SUBNET)
+		if !ok {
+			continue
+		}
+
+		return LookupContext{
+			ClientSubnet: true,
+			Family:       subnet.Family,
+			SourcePrefix: subnet.SourceNetmask,
+			Address:      subnet.Address,
+		}
+	}
+
+	return LookupContext{}
+}
+
+// lookupResult mirrors the (Name, Set) shape returned by Zone.Lookup so the
+// HandlerEx path can be folded into the same answer-building code.
+type lookupResult struct {
+	Name string
+	Set  Set
+}
+
+// lookup resolves name/typ for zone, calling the ECS-aware Zone.HandlerEx
+// when the zone configured one and falling back to the regular Zone.Lookup
+// (which in turn calls Zone.Handler) otherwise.
+func (s *Server) lookup(zone *Zone, ctx LookupContext, name string, typ Type) ([]lookupResult, bool, error) {
+	if zone.HandlerEx == nil {
+		raw, avl, err := zone.Lookup(name, typ)
+		if err != nil {
+			return nil, false, err
+		}
+
+		results := make([]lookupResult, 0, len(raw))
+		for _, res := range raw {
+			results = append(results, lookupResult{Name: res.Name, Set: res.Set})
+		}
+
+		return results, avl, nil
+	}
+
+	records, scope, err := zone.HandlerEx(ctx, typ, name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(records) == 0 {
+		// fall back to probing common types to tell NODATA from NXDOMAIN,
+		// same as Zone.Lookup's avl signal
+		return nil, s.nameInUse(zone, name), nil
+	}
+
+	set := Set{Name: name, Type: typ, Records: records, Scope: scope}
+
+	err = set.Validate()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return []lookupResult{{Name: name, Set: set}}, true, nil
+}
+
+// ecsReplyOption builds the EDNS0 Client Subnet option echoed back to the
+// client, scoped to the answer's specificity as reported by the handler.
+func ecsReplyOption(ctx LookupContext, scope uint8) *dns.EDNS0_SUBNET {
+	if !ctx.ClientSubnet {
+		return nil
+	}
+
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        ctx.Family,
+		SourceNetmask: ctx.SourcePrefix,
+		SourceScope:   scope,
+		Address:       ctx.Address,
+	}
+}
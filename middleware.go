@@ -0,0 +1,321 @@
+package newdns
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Handler answers a single DNS request. It is the unit that Middleware
+// wraps to build the request pipeline.
+type Handler interface {
+	ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (rcode int, err error)
+}
+
+// HandlerFunc adapts a plain function to the Handler interface.
+type HandlerFunc func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error)
+
+// ServeDNS calls f.
+func (f HandlerFunc) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	return f(ctx, w, r)
+}
+
+// Middleware wraps a Handler to add cross-cutting behavior (logging,
+// metrics, rate limiting, caching, policy filtering, ...) around the core
+// zone-answering handler.
+type Middleware func(next Handler) Handler
+
+// dispatch is registered with miekg/dns and runs the configured middleware
+// chain around the core zone-answering handler.
+func (s *Server) dispatch(w dns.ResponseWriter, rq *dns.Msg) {
+	terminal := HandlerFunc(func(_ context.Context, w dns.ResponseWriter, rq *dns.Msg) (int, error) {
+		// capture what serve actually wrote so LoggingMiddleware and
+		// MetricsMiddleware observe the real rcode instead of a hardcoded one
+		capture := &capturingWriter{ResponseWriter: w}
+
+		s.serve(capture, rq)
+
+		if capture.msg == nil {
+			return dns.RcodeServerFailure, nil
+		}
+
+		return capture.msg.Rcode, nil
+	})
+
+	var h Handler = terminal
+	for i := len(s.config.Middleware) - 1; i >= 0; i-- {
+		h = s.config.Middleware[i](h)
+	}
+
+	_, _ = h.ServeDNS(context.Background(), w, rq)
+}
+
+// LoggingMiddleware logs every request with its question, result code and
+// latency using the provided logger.
+func LoggingMiddleware(logger func(format string, args ...interface{})) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, rq *dns.Msg) (int, error) {
+			start := time.Now()
+
+			rcode, err := next.ServeDNS(ctx, w, rq)
+
+			var question string
+			if len(rq.Question) == 1 {
+				question = fmt.Sprintf("%s %s", dns.TypeToString[rq.Question[0].Qtype], rq.Question[0].Name)
+			}
+
+			logger("newdns: %s rcode=%s size=%d took=%s", question, dns.RcodeToString[rcode], rq.Len(), time.Since(start))
+
+			return rcode, err
+		})
+	}
+}
+
+// MetricsRecorder receives per-request measurements for export to a metrics
+// system such as Prometheus.
+type MetricsRecorder interface {
+	// ObserveRequest is called once per request with the question type, the
+	// resulting rcode and the time taken to answer it.
+	ObserveRequest(qtype uint16, rcode int, duration time.Duration)
+}
+
+// MetricsMiddleware reports qtype/rcode/latency measurements to recorder for
+// every handled request.
+func MetricsMiddleware(recorder MetricsRecorder) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, rq *dns.Msg) (int, error) {
+			start := time.Now()
+
+			rcode, err := next.ServeDNS(ctx, w, rq)
+
+			var qtype uint16
+			if len(rq.Question) == 1 {
+				qtype = rq.Question[0].Qtype
+			}
+
+			recorder.ObserveRequest(qtype, rcode, time.Since(start))
+
+			return rcode, err
+		})
+	}
+}
+
+// tokenBucket is a simple per-client rate limiter.
+type tokenBucket struct {
+	tokens   float64
+	lastFill time.Time
+}
+
+// rateLimitIdleTTL is how long a client's bucket may sit unused before it
+// becomes eligible for reclamation.
+const rateLimitIdleTTL = 5 * time.Minute
+
+// rateLimitSweepThreshold is how many tracked buckets accumulate before a
+// sweep for idle ones runs, amortizing the sweep's cost across requests
+// instead of paying it on every single one.
+const rateLimitSweepThreshold = 10000
+
+// RateLimitMiddleware throttles requests per client address using a token
+// bucket with the given refill rate (requests per second) and burst size.
+// Buckets idle for longer than rateLimitIdleTTL are reclaimed once the
+// tracked set grows past rateLimitSweepThreshold, so a flood of requests
+// from randomized (e.g. spoofed UDP) source addresses cannot grow the
+// tracking map without bound.
+func RateLimitMiddleware(rate float64, burst int) Middleware {
+	var mutex sync.Mutex
+	buckets := map[string]*tokenBucket{}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, rq *dns.Msg) (int, error) {
+			client := w.RemoteAddr().String()
+
+			mutex.Lock()
+
+			now := time.Now()
+
+			if len(buckets) > rateLimitSweepThreshold {
+				for addr, b := range buckets {
+					if now.Sub(b.lastFill) > rateLimitIdleTTL {
+						delete(buckets, addr)
+					}
+				}
+			}
+
+			bucket, ok := buckets[client]
+			if !ok {
+				bucket = &tokenBucket{tokens: float64(burst), lastFill: now}
+				buckets[client] = bucket
+			}
+
+			bucket.tokens += now.Sub(bucket.lastFill).Seconds() * rate
+			if bucket.tokens > float64(burst) {
+				bucket.tokens = float64(burst)
+			}
+			bucket.lastFill = now
+
+			allowed := bucket.tokens >= 1
+			if allowed {
+				bucket.tokens--
+			}
+			mutex.Unlock()
+
+			if !allowed {
+				rs := new(dns.Msg)
+				rs.SetRcode(rq, dns.RcodeRefused)
+				_ = w.WriteMsg(rs)
+				return dns.RcodeRefused, nil
+			}
+
+			return next.ServeDNS(ctx, w, rq)
+		})
+	}
+}
+
+// cacheEntryMsg holds a cached reply alongside its expiration.
+type cacheEntryMsg struct {
+	msg     *dns.Msg
+	expires time.Time
+}
+
+// CacheMiddleware answers repeated queries from an in-memory cache honoring
+// each cached message's minimum TTL, avoiding repeat work for the core
+// handler.
+func CacheMiddleware(maxEntries int) Middleware {
+	var mutex sync.Mutex
+	entries := map[string]cacheEntryMsg{}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, rq *dns.Msg) (int, error) {
+			if len(rq.Question) != 1 || rq.Opcode != dns.OpcodeQuery {
+				return next.ServeDNS(ctx, w, rq)
+			}
+
+			key := fmt.Sprintf("%s %d", rq.Question[0].Name, rq.Question[0].Qtype)
+
+			mutex.Lock()
+			entry, ok := entries[key]
+			mutex.Unlock()
+
+			if ok && time.Now().Before(entry.expires) {
+				rs := entry.msg.Copy()
+				rs.Id = rq.Id
+				_ = w.WriteMsg(rs)
+				return rs.Rcode, nil
+			}
+
+			capture := &capturingWriter{ResponseWriter: w}
+
+			rcode, err := next.ServeDNS(ctx, capture, rq)
+			if err == nil && capture.msg != nil {
+				ttl := minTTL(capture.msg)
+				if ttl > 0 {
+					mutex.Lock()
+					if len(entries) >= maxEntries {
+						for k := range entries {
+							delete(entries, k)
+							break
+						}
+					}
+					entries[key] = cacheEntryMsg{msg: capture.msg, expires: time.Now().Add(ttl)}
+					mutex.Unlock()
+				}
+			}
+
+			return rcode, err
+		})
+	}
+}
+
+// capturingWriter records the message written by the wrapped handler while
+// still forwarding it to the real client.
+type capturingWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *capturingWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// minTTL returns the smallest TTL across all records in a message's answer
+// section, or zero if it has none.
+func minTTL(m *dns.Msg) time.Duration {
+	var lowest uint32
+	found := false
+
+	for _, rr := range m.Answer {
+		ttl := rr.Header().Ttl
+		if !found || ttl < lowest {
+			lowest = ttl
+			found = true
+		}
+	}
+
+	return time.Duration(lowest) * time.Second
+}
+
+// RPZRule describes a single Response Policy Zone override.
+type RPZRule struct {
+	// The exact or wildcard-prefixed (e.g. "*.example.com.") name matched
+	// against the question.
+	Name string
+
+	// The action to take: "nxdomain", "nodata" or "passthru".
+	Action string
+}
+
+// RPZMiddleware filters requests against a static Response Policy Zone,
+// rewriting matching queries to NXDOMAIN or NODATA before they reach the
+// core handler.
+func RPZMiddleware(rules []RPZRule) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, rq *dns.Msg) (int, error) {
+			if len(rq.Question) == 1 {
+				name := dns.Name(rq.Question[0].Name).String()
+
+				for _, rule := range rules {
+					if !rpzMatches(rule.Name, name) {
+						continue
+					}
+
+					switch rule.Action {
+					case "nxdomain":
+						rs := new(dns.Msg)
+						rs.SetRcode(rq, dns.RcodeNameError)
+						rs.Authoritative = true
+						_ = w.WriteMsg(rs)
+						return dns.RcodeNameError, nil
+					case "nodata":
+						rs := new(dns.Msg)
+						rs.SetRcode(rq, dns.RcodeSuccess)
+						rs.Authoritative = true
+						_ = w.WriteMsg(rs)
+						return dns.RcodeSuccess, nil
+					}
+
+					break
+				}
+			}
+
+			return next.ServeDNS(ctx, w, rq)
+		})
+	}
+}
+
+// rpzMatches reports whether name matches an RPZ trigger, supporting a
+// leading "*." wildcard that matches the owner name and all its subdomains.
+func rpzMatches(rule, name string) bool {
+	if rule == name {
+		return true
+	}
+
+	if len(rule) > 2 && rule[:2] == "*." {
+		return dns.IsSubDomain(rule[2:], name)
+	}
+
+	return false
+}
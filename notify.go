@@ -0,0 +1,144 @@
+package newdns
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// handleNotify answers an incoming NOTIFY request (RFC 1996) by invoking the
+// zone's OnNotify callback and acknowledging with NOERROR.
+func (s *Server) handleNotify(w dns.ResponseWriter, rq *dns.Msg) {
+	rs := new(dns.Msg)
+	rs.SetReply(rq)
+	rs.Authoritative = true
+
+	// verify tsig if present, refusing the request on failure
+	if _, ok := s.verifyTSIG(w, rq, rs); !ok {
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	if len(rq.Question) != 1 {
+		rs.Rcode = dns.RcodeFormatError
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	name := strings.ToLower(dns.Name(rq.Question[0].Name).String())
+
+	zone, err := s.config.Handler(name)
+	if err != nil {
+		rs.Rcode = dns.RcodeServerFailure
+		s.reportError(rq, err.Error())
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	if zone == nil {
+		rs.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	var serial uint32
+	for _, rr := range rq.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			serial = soa.Serial
+			break
+		}
+	}
+
+	if zone.OnNotify != nil {
+		err = zone.OnNotify(w.RemoteAddr(), serial)
+		if err != nil {
+			rs.Rcode = dns.RcodeServerFailure
+			s.reportError(rq, err.Error())
+			_ = w.WriteMsg(rs)
+			_ = w.Close()
+			return
+		}
+	}
+
+	_ = w.WriteMsg(rs)
+	_ = w.Close()
+}
+
+// Notify sends a NOTIFY message (RFC 1996) for zoneName, carrying the given
+// serial, to each of the given secondary addresses (host:port). If
+// targets is empty, it notifies the zone's configured Secondaries instead.
+// It retries with exponential backoff until a response arrives or the
+// overall attempt times out.
+func (s *Server) Notify(zoneName string, serial uint32, targets []string) error {
+	if len(targets) == 0 {
+		zone, err := s.config.Handler(zoneName)
+		if err != nil {
+			return err
+		}
+
+		if zone == nil {
+			return nil
+		}
+
+		targets = zone.Secondaries
+	}
+
+	var lastErr error
+
+	for _, target := range targets {
+		err := s.notifyOne(zoneName, serial, target)
+		if err != nil {
+			lastErr = err
+			s.reportError(nil, err.Error())
+		}
+	}
+
+	return lastErr
+}
+
+// notifyOne sends a single NOTIFY to target, retrying with exponential
+// backoff for up to five attempts.
+func (s *Server) notifyOne(zoneName string, serial uint32, target string) error {
+	msg := new(dns.Msg)
+	msg.SetNotify(zoneName)
+	msg.Authoritative = true
+	msg.Answer = []dns.RR{
+		&dns.SOA{
+			Hdr: dns.RR_Header{
+				Name:   zoneName,
+				Rrtype: dns.TypeSOA,
+				Class:  dns.ClassINET,
+			},
+			Serial: serial,
+		},
+	}
+
+	client := &dns.Client{Net: "udp", Timeout: 2 * time.Second}
+
+	backoff := time.Second
+
+	var lastErr error
+
+	for attempt := 0; attempt < 5; attempt++ {
+		reply, _, err := client.Exchange(msg, target)
+		if err == nil && reply != nil && reply.Rcode == dns.RcodeSuccess {
+			return nil
+		}
+
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = dns.ErrRcode
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	return lastErr
+}
@@ -19,12 +19,45 @@ type Config struct {
 
 	// Reporter is the callback called with request errors.
 	Reporter func(error)
+
+	// TSIGSecrets maps TSIG key names to their base64 encoded secrets. If
+	// set, transfers, notifies and updates may be authenticated per
+	// RFC 2845.
+	TSIGSecrets map[string]string
+
+	// Middleware is a chain of middleware applied around the core
+	// zone-answering handler, in the order given (the first middleware sees
+	// the request first).
+	Middleware []Middleware
+
+	// ANYMode controls how ANY queries are answered.
+	//
+	// Default: ANYMinimal.
+	ANYMode ANYMode
 }
 
+// ANYMode determines how the server answers dns.TypeANY queries.
+type ANYMode int
+
+const (
+	// ANYMinimal answers with a single synthesized HINFO record per
+	// RFC 8482, avoiding the amplification and cache-fragmentation problems
+	// of a full ANY answer.
+	ANYMinimal ANYMode = iota
+
+	// ANYRefuse replies with NotImplemented, as legacy resolvers expect.
+	ANYRefuse
+
+	// ANYFull enumerates every supported type for the name and returns
+	// whatever records are found, matching pre-RFC 8482 behavior.
+	ANYFull
+)
+
 // Server is a DNS server.
 type Server struct {
-	config Config
-	close  chan struct{}
+	config   Config
+	close    chan struct{}
+	sigCache *signatureCache
 }
 
 // NewServer creates and returns a new DNS server.
@@ -44,11 +77,11 @@ func NewServer(config Config) *Server {
 // on the first accept error and close all servers.
 func (s *Server) Run(addr string) error {
 	// register handler
-	dns.HandleFunc(".", s.handler)
+	dns.HandleFunc(".", s.dispatch)
 
 	// prepare servers
-	udp := &dns.Server{Addr: addr, Net: "udp", MsgAcceptFunc: s.accept}
-	tcp := &dns.Server{Addr: addr, Net: "tcp", MsgAcceptFunc: s.accept}
+	udp := &dns.Server{Addr: addr, Net: "udp", MsgAcceptFunc: s.accept, TsigSecret: s.config.TSIGSecrets}
+	tcp := &dns.Server{Addr: addr, Net: "tcp", MsgAcceptFunc: s.accept, TsigSecret: s.config.TSIGSecrets}
 
 	// prepare errors
 	errs := make(chan error, 2)
@@ -89,7 +122,8 @@ func (s *Server) accept(dh dns.Header) dns.MsgAcceptAction {
 	}
 
 	// check opcode
-	if int(dh.Bits>>11)&0xF != dns.OpcodeQuery {
+	opcode := int(dh.Bits>>11) & 0xF
+	if opcode != dns.OpcodeQuery && opcode != dns.OpcodeNotify && opcode != dns.OpcodeUpdate {
 		return dns.MsgIgnore
 	}
 
@@ -101,7 +135,21 @@ func (s *Server) accept(dh dns.Header) dns.MsgAcceptAction {
 	return dns.MsgAccept
 }
 
-func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
+func (s *Server) serve(w dns.ResponseWriter, rq *dns.Msg) {
+	// dispatch notifies separately as they carry a SOA question but no
+	// regular answer
+	if rq.Opcode == dns.OpcodeNotify {
+		s.handleNotify(w, rq)
+		return
+	}
+
+	// dispatch dynamic updates separately as they use the zone section for
+	// the zone name rather than a regular question
+	if rq.Opcode == dns.OpcodeUpdate {
+		s.handleUpdate(w, rq)
+		return
+	}
+
 	// prepare response
 	rs := new(dns.Msg)
 	rs.SetReply(rq)
@@ -112,6 +160,14 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 	// set flag
 	rs.Authoritative = true
 
+	// verify tsig if present, refusing the request on failure
+	tsigKey, ok := s.verifyTSIG(w, rq, rs)
+	if !ok {
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
 	// check edns
 	if rq.IsEdns0() != nil {
 		// use edns in reply
@@ -133,15 +189,12 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 		return
 	}
 
-	// check any type
-	if question.Qtype == dns.TypeANY {
-		s.writeError(w, rs, dns.RcodeNotImplemented)
-		return
-	}
-
 	// get name
 	name := strings.ToLower(dns.Name(question.Name).String())
 
+	// extract edns0 client subnet for handlers that support it
+	ecsCtx := extractLookupContext(rq)
+
 	// get zone
 	zone, err := s.config.Handler(name)
 	if err != nil {
@@ -165,6 +218,18 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 		return
 	}
 
+	// handle zone transfers
+	if question.Qtype == dns.TypeAXFR || question.Qtype == dns.TypeIXFR {
+		s.serveTransfer(w, rq, zone, tsigKey)
+		return
+	}
+
+	// handle ANY queries per the configured mode
+	if question.Qtype == dns.TypeANY {
+		s.writeAnyResponse(w, rq, rs, zone, name)
+		return
+	}
+
 	// answer SOA directly
 	if question.Qtype == dns.TypeSOA && name == zone.Name {
 		s.writeSOAResponse(w, rq, rs, zone)
@@ -181,13 +246,14 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 	typ := Type(question.Qtype)
 
 	// return error if type is not supported
-	if !typ.valid() {
+	if !typ.valid() && !typ.modern() {
 		s.writeErrorWithSOA(w, rq, rs, zone, dns.RcodeNameError)
 		return
 	}
 
-	// lookup main record
-	result, avl, err := zone.Lookup(name, typ)
+	// lookup main record, preferring the extended, ECS-aware handler if the
+	// zone configured one
+	results, avl, err := s.lookup(zone, ecsCtx, name, typ)
 	if err != nil {
 		s.writeError(w, rs, dns.RcodeServerFailure)
 		s.reportError(rq, err.Error())
@@ -195,7 +261,7 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 	}
 
 	// check result
-	if len(result) == 0 {
+	if len(results) == 0 {
 		// write SOA with success code to indicate availability of other sets
 		// if sets are available
 		if avl {
@@ -210,8 +276,12 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 	}
 
 	// set answer
-	for _, res := range result {
-		rs.Answer = append(rs.Answer, res.Set.convert(zone, transferCase(question.Name, res.Name))...)
+	for _, res := range results {
+		if res.Set.Type.modern() {
+			rs.Answer = append(rs.Answer, res.Set.convertModern(transferCase(question.Name, res.Name))...)
+		} else {
+			rs.Answer = append(rs.Answer, res.Set.convert(zone, transferCase(question.Name, res.Name))...)
+		}
 	}
 
 	// check answers
@@ -220,7 +290,7 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 		case *dns.MX:
 			// lookup internal MX target A and AAAA records
 			if InZone(zone.Name, record.Mx) {
-				result, _, err = zone.Lookup(record.Mx, TypeA, TypeAAAA)
+				glue, _, err := zone.Lookup(record.Mx, TypeA, TypeAAAA)
 				if err != nil {
 					s.writeError(w, rs, dns.RcodeServerFailure)
 					s.reportError(rq, err.Error())
@@ -228,7 +298,37 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 				}
 
 				// add results to extra
-				for _, res := range result {
+				for _, res := range glue {
+					rs.Extra = append(rs.Extra, res.Set.convert(zone, transferCase(question.Name, res.Name))...)
+				}
+			}
+		case *dns.SVCB:
+			// lookup internal SVCB target A and AAAA records
+			if InZone(zone.Name, record.Target) {
+				glue, _, err := zone.Lookup(record.Target, TypeA, TypeAAAA)
+				if err != nil {
+					s.writeError(w, rs, dns.RcodeServerFailure)
+					s.reportError(rq, err.Error())
+					return
+				}
+
+				// add results to extra
+				for _, res := range glue {
+					rs.Extra = append(rs.Extra, res.Set.convert(zone, transferCase(question.Name, res.Name))...)
+				}
+			}
+		case *dns.HTTPS:
+			// lookup internal HTTPS target A and AAAA records
+			if InZone(zone.Name, record.Target) {
+				glue, _, err := zone.Lookup(record.Target, TypeA, TypeAAAA)
+				if err != nil {
+					s.writeError(w, rs, dns.RcodeServerFailure)
+					s.reportError(rq, err.Error())
+					return
+				}
+
+				// add results to extra
+				for _, res := range glue {
 					rs.Extra = append(rs.Extra, res.Set.convert(zone, transferCase(question.Name, res.Name))...)
 				}
 			}
@@ -248,8 +348,24 @@ func (s *Server) handler(w dns.ResponseWriter, rq *dns.Msg) {
 		})
 	}
 
+	// echo the negotiated client subnet scope so downstream resolvers know
+	// how specific the answer is and can cache it per-subnet
+	if ecsCtx.ClientSubnet {
+		var scope uint8
+		for _, res := range results {
+			if res.Set.Scope > scope {
+				scope = res.Set.Scope
+			}
+		}
+
+		if opt := ecsReplyOption(ecsCtx, scope); opt != nil {
+			edns := rs.IsEdns0()
+			edns.Option = append(edns.Option, opt)
+		}
+	}
+
 	// write message
-	s.writeMessage(w, rq, rs)
+	s.writeMessage(w, rq, rs, zone)
 }
 
 func (s *Server) writeSOAResponse(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zone) {
@@ -263,7 +379,7 @@ func (s *Server) writeSOAResponse(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Z
 		},
 		Ns:      zone.MasterNameServer,
 		Mbox:    emailToDomain(zone.AdminEmail),
-		Serial:  1,
+		Serial:  zone.Serial,
 		Refresh: durationToTime(zone.Refresh),
 		Retry:   durationToTime(zone.Retry),
 		Expire:  durationToTime(zone.Expire),
@@ -284,7 +400,7 @@ func (s *Server) writeSOAResponse(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Z
 	}
 
 	// write message
-	s.writeMessage(w, rq, rs)
+	s.writeMessage(w, rq, rs, zone)
 }
 
 func (s *Server) writeNSResponse(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zone) {
@@ -302,7 +418,7 @@ func (s *Server) writeNSResponse(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zo
 	}
 
 	// write message
-	s.writeMessage(w, rq, rs)
+	s.writeMessage(w, rq, rs, zone)
 }
 
 func (s *Server) writeErrorWithSOA(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zone, code int) {
@@ -319,18 +435,34 @@ func (s *Server) writeErrorWithSOA(w dns.ResponseWriter, rq, rs *dns.Msg, zone *
 		},
 		Ns:      zone.MasterNameServer,
 		Mbox:    emailToDomain(zone.AdminEmail),
-		Serial:  1,
+		Serial:  zone.Serial,
 		Refresh: durationToTime(zone.Refresh),
 		Retry:   durationToTime(zone.Retry),
 		Expire:  durationToTime(zone.Expire),
 		Minttl:  durationToTime(zone.MinTTL),
 	})
 
+	// add denial of existence records for NXDOMAIN/NODATA responses, but only
+	// if the client asked for DNSSEC data via the EDNS0 DO bit, same as
+	// signMessage
+	if code == dns.RcodeNameError || code == dns.RcodeSuccess {
+		if edns := rq.IsEdns0(); edns != nil && edns.Do() {
+			name := strings.ToLower(dns.Name(rq.Question[0].Name).String())
+			rs.Ns = append(rs.Ns, s.denialRecords(zone, name, nil)...)
+		}
+	}
+
 	// write message
-	s.writeMessage(w, rq, rs)
+	s.writeMessage(w, rq, rs, zone)
 }
 
-func (s *Server) writeMessage(w dns.ResponseWriter, rq, rs *dns.Msg) {
+func (s *Server) writeMessage(w dns.ResponseWriter, rq, rs *dns.Msg, zone *Zone) {
+	// sign the response if the zone has DNSSEC keys and the client asked
+	// for DNSSEC data via the EDNS0 DO bit
+	if zone != nil {
+		s.signMessage(rq, rs, zone)
+	}
+
 	// get buffer size
 	var buffer = 512
 	if rq.IsEdns0() != nil {
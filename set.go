@@ -19,10 +19,23 @@ type Set struct {
 	// The records in the set.
 	Records []Record
 
+	// The structured records for a modern set, used instead of Records when
+	// Type is SVCB, HTTPS, CAA, TLSA or SSHFP, whose parameters do not fit
+	// the legacy Record shape.
+	Modern []ModernRecord
+
 	// The TTL of the set.
 	//
 	// Default: 5m.
 	TTL time.Duration
+
+	// The EDNS0 Client Subnet scope prefix-length the answer is specific to.
+	// Handlers set this when they tailor the set to the subnet advertised in
+	// the request (see LookupContext). A value of 0 means the answer is
+	// independent of the client's network and may be cached globally.
+	//
+	// Only meaningful when returned from Zone.HandlerEx.
+	Scope uint8
 }
 
 // Validate will validate the set and ensure defaults.
@@ -32,6 +45,21 @@ func (s *Set) Validate() error {
 		return errors.Errorf("invalid name: %s", s.Name)
 	}
 
+	// check modern records separately, as they carry their own parameters
+	// instead of a Record and predate the legacy type validation
+	if s.Type.modern() {
+		if len(s.Modern) == 0 {
+			return errors.Errorf("missing records")
+		}
+
+		// set default ttl
+		if s.TTL == 0 {
+			s.TTL = 5 * time.Minute
+		}
+
+		return nil
+	}
+
 	// check type
 	if !s.Type.valid() {
 		return errors.Errorf("invalid type: %d", s.Type)
@@ -0,0 +1,307 @@
+package newdns
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// Additional record types supported alongside the original set.
+const (
+	// SVCB is the General Purpose Service Binding record (RFC 9460).
+	SVCB Type = Type(dns.TypeSVCB)
+
+	// HTTPS is the HTTPS-specific Service Binding record (RFC 9460).
+	HTTPS Type = Type(dns.TypeHTTPS)
+
+	// CAA restricts which certificate authorities may issue certificates
+	// for the name (RFC 6844).
+	CAA Type = Type(dns.TypeCAA)
+
+	// TLSA associates a TLS certificate or public key with the name
+	// (RFC 6698).
+	TLSA Type = Type(dns.TypeTLSA)
+
+	// SSHFP publishes an SSH public key fingerprint for the name (RFC 4255).
+	SSHFP Type = Type(dns.TypeSSHFP)
+)
+
+// modern reports whether t is one of the record types whose parameters are
+// carried via Set.Modern rather than Set.Records.
+func (t Type) modern() bool {
+	switch t {
+	case SVCB, HTTPS, CAA, TLSA, SSHFP:
+		return true
+	default:
+		return false
+	}
+}
+
+// ModernRecord builds the wire-format resource record for a single entry of
+// a modern set (SVCB, HTTPS, CAA, TLSA or SSHFP). SVCBParams, HTTPSParams,
+// CAAParams, TLSAParams and SSHFPParams all implement it.
+type ModernRecord interface {
+	toRR(owner string, ttl uint32) dns.RR
+}
+
+// convertModern renders s into the resource records it represents, for a set whose
+// Type is modern (see Type.modern). It mirrors Set.convert for legacy types.
+func (s Set) convertModern(owner string) []dns.RR {
+	rrs := make([]dns.RR, 0, len(s.Modern))
+
+	for _, record := range s.Modern {
+		rrs = append(rrs, record.toRR(owner, durationToTime(s.TTL)))
+	}
+
+	return rrs
+}
+
+// SVCBParams holds the structured parameters of an SVCB or HTTPS record so
+// callers do not have to hand-encode the wire format themselves.
+type SVCBParams struct {
+	// The priority of this binding relative to others at the same owner
+	// name. A priority of 0 indicates alias mode.
+	Priority uint16
+
+	// The target name providing the service, or "." for the owner name
+	// itself.
+	Target string
+
+	// The application protocols supported, e.g. "h2", "h3".
+	ALPN []string
+
+	// Whether to disable the default ALPN ("http/1.1") fallback.
+	NoDefaultALPN bool
+
+	// The port used by the service, if not the default for the scheme.
+	Port uint16
+
+	// A hint of the IPv4 addresses reachable at Target.
+	IPv4Hint []net.IP
+
+	// A hint of the IPv6 addresses reachable at Target.
+	IPv6Hint []net.IP
+
+	// The Encrypted Client Hello configuration, if any.
+	ECH []byte
+
+	// The keys that clients must understand to use this binding.
+	Mandatory []string
+}
+
+// KeyValues renders the structured parameters as the dns.SVCBKeyValue list
+// expected by a dns.SVCB or dns.HTTPS record's Value field.
+func (p SVCBParams) KeyValues() []dns.SVCBKeyValue {
+	var values []dns.SVCBKeyValue
+
+	if len(p.Mandatory) > 0 {
+		codes := make([]dns.SVCBKey, 0, len(p.Mandatory))
+		for _, key := range p.Mandatory {
+			codes = append(codes, keyFromString(key))
+		}
+
+		values = append(values, &dns.SVCBMandatory{Code: codes})
+	}
+
+	if len(p.ALPN) > 0 {
+		values = append(values, &dns.SVCBAlpn{Alpn: p.ALPN})
+	}
+
+	if p.NoDefaultALPN {
+		values = append(values, &dns.SVCBNoDefaultAlpn{})
+	}
+
+	if p.Port > 0 {
+		values = append(values, &dns.SVCBPort{Port: p.Port})
+	}
+
+	if len(p.IPv4Hint) > 0 {
+		values = append(values, &dns.SVCBIPv4Hint{Hint: p.IPv4Hint})
+	}
+
+	if len(p.IPv6Hint) > 0 {
+		values = append(values, &dns.SVCBIPv6Hint{Hint: p.IPv6Hint})
+	}
+
+	if len(p.ECH) > 0 {
+		values = append(values, &dns.SVCBECHConfig{ECH: p.ECH})
+	}
+
+	return values
+}
+
+// keyFromString maps an SVCB parameter key name (e.g. "alpn", "port") to its
+// registered dns.SVCBKey.
+func keyFromString(key string) dns.SVCBKey {
+	switch key {
+	case "mandatory":
+		return dns.SVCB_MANDATORY
+	case "alpn":
+		return dns.SVCB_ALPN
+	case "no-default-alpn":
+		return dns.SVCB_NO_DEFAULT_ALPN
+	case "port":
+		return dns.SVCB_PORT
+	case "ipv4hint":
+		return dns.SVCB_IPV4HINT
+	case "ech":
+		return dns.SVCB_ECHCONFIG
+	case "ipv6hint":
+		return dns.SVCB_IPV6HINT
+	default:
+		return dns.SVCBKey(0)
+	}
+}
+
+// SVCBRecord builds a dns.SVCB record for the given owner name from p.
+func (p SVCBParams) SVCBRecord(owner string, ttl uint32) *dns.SVCB {
+	return &dns.SVCB{
+		Hdr: dns.RR_Header{
+			Name:   owner,
+			Rrtype: dns.TypeSVCB,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Priority: p.Priority,
+		Target:   p.Target,
+		Value:    p.KeyValues(),
+	}
+}
+
+// HTTPSRecord builds a dns.HTTPS record for the given owner name from p.
+func (p SVCBParams) HTTPSRecord(owner string, ttl uint32) *dns.HTTPS {
+	return &dns.HTTPS{
+		SVCB: dns.SVCB{
+			Hdr: dns.RR_Header{
+				Name:   owner,
+				Rrtype: dns.TypeHTTPS,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Priority: p.Priority,
+			Target:   p.Target,
+			Value:    p.KeyValues(),
+		},
+	}
+}
+
+// toRR implements ModernRecord for a Set with Type SVCB.
+func (p SVCBParams) toRR(owner string, ttl uint32) dns.RR {
+	return p.SVCBRecord(owner, ttl)
+}
+
+// HTTPSParams holds the structured parameters of an HTTPS record. It is
+// identical to SVCBParams but selects HTTPSRecord when used as a
+// ModernRecord, since SVCB and HTTPS sets share the same parameter shape.
+type HTTPSParams SVCBParams
+
+// toRR implements ModernRecord for a Set with Type HTTPS.
+func (p HTTPSParams) toRR(owner string, ttl uint32) dns.RR {
+	return SVCBParams(p).HTTPSRecord(owner, ttl)
+}
+
+// CAAParams holds the structured parameters of a CAA record (RFC 6844).
+type CAAParams struct {
+	// Whether the record is critical, i.e. must be understood by the CA.
+	Critical bool
+
+	// The property, one of "issue", "issuewild" or "iodef".
+	Tag string
+
+	// The property value, e.g. the authorized CA's domain name.
+	Value string
+}
+
+// CAARecord builds a dns.CAA record for the given owner name from p.
+func (p CAAParams) CAARecord(owner string, ttl uint32) *dns.CAA {
+	var flag uint8
+	if p.Critical {
+		flag = 1 << 7
+	}
+
+	return &dns.CAA{
+		Hdr: dns.RR_Header{
+			Name:   owner,
+			Rrtype: dns.TypeCAA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Flag:  flag,
+		Tag:   p.Tag,
+		Value: p.Value,
+	}
+}
+
+// toRR implements ModernRecord for a Set with Type CAA.
+func (p CAAParams) toRR(owner string, ttl uint32) dns.RR {
+	return p.CAARecord(owner, ttl)
+}
+
+// TLSAParams holds the structured parameters of a TLSA record (RFC 6698).
+type TLSAParams struct {
+	// The certificate usage, e.g. 3 for "DANE-EE".
+	Usage uint8
+
+	// The selector, e.g. 1 for "SPKI".
+	Selector uint8
+
+	// The matching type, e.g. 1 for "SHA-256".
+	MatchingType uint8
+
+	// The certificate association data, hex encoded.
+	Certificate string
+}
+
+// TLSARecord builds a dns.TLSA record for the given owner name from p.
+func (p TLSAParams) TLSARecord(owner string, ttl uint32) *dns.TLSA {
+	return &dns.TLSA{
+		Hdr: dns.RR_Header{
+			Name:   owner,
+			Rrtype: dns.TypeTLSA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Usage:        p.Usage,
+		Selector:     p.Selector,
+		MatchingType: p.MatchingType,
+		Certificate:  p.Certificate,
+	}
+}
+
+// toRR implements ModernRecord for a Set with Type TLSA.
+func (p TLSAParams) toRR(owner string, ttl uint32) dns.RR {
+	return p.TLSARecord(owner, ttl)
+}
+
+// SSHFPParams holds the structured parameters of an SSHFP record
+// (RFC 4255).
+type SSHFPParams struct {
+	// The public key algorithm, e.g. 4 for "Ed25519".
+	Algorithm uint8
+
+	// The fingerprint type, e.g. 2 for "SHA-256".
+	Type uint8
+
+	// The fingerprint, hex encoded.
+	FingerPrint string
+}
+
+// SSHFPRecord builds a dns.SSHFP record for the given owner name from p.
+func (p SSHFPParams) SSHFPRecord(owner string, ttl uint32) *dns.SSHFP {
+	return &dns.SSHFP{
+		Hdr: dns.RR_Header{
+			Name:   owner,
+			Rrtype: dns.TypeSSHFP,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Algorithm:   p.Algorithm,
+		Type:        p.Type,
+		FingerPrint: p.FingerPrint,
+	}
+}
+
+// toRR implements ModernRecord for a Set with Type SSHFP.
+func (p SSHFPParams) toRR(owner string, ttl uint32) dns.RR {
+	return p.SSHFPRecord(owner, ttl)
+}
@@ -0,0 +1,179 @@
+package newdns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// Change describes a single delta between two zone serials, as returned by
+// a Journal for IXFR.
+type Change struct {
+	// The zone serial before this delta was applied.
+	OldSerial uint32
+
+	// The zone serial after this delta was applied.
+	NewSerial uint32
+
+	// The RRsets added since the previous serial.
+	Added []Set
+
+	// The RRsets removed since the previous serial.
+	Removed []Set
+}
+
+// Journal provides incremental zone history so IXFR requests can be
+// answered with only what changed since the requester's serial.
+type Journal interface {
+	// Since returns the ordered list of changes needed to bring a secondary
+	// at the given serial up to the current serial, along with the current
+	// serial. If the requested serial is unknown, ok is false and the
+	// caller should fall back to a full AXFR.
+	Since(serial uint32) (changes []Change, current uint32, ok bool, err error)
+}
+
+// serveTransfer answers an AXFR or IXFR request by streaming the zone's SOA,
+// all (or changed) RRsets, and a closing SOA over the transfer connection.
+func (s *Server) serveTransfer(w dns.ResponseWriter, rq *dns.Msg, zone *Zone, tsigKey string) {
+	// zone transfers are only ever carried over TCP
+	if w.RemoteAddr().Network() != "tcp" {
+		s.refuseTransfer(w, rq)
+		return
+	}
+
+	// require tsig authentication if configured
+	if zone.RequireTSIGForTransfer && tsigKey == "" {
+		s.refuseTransfer(w, rq)
+		return
+	}
+
+	// check authorization
+	if zone.AllowTransfer == nil || !zone.AllowTransfer(w.RemoteAddr()) {
+		s.refuseTransfer(w, rq)
+		return
+	}
+
+	soa := soaRecord(zone, zone.Serial)
+
+	var rrs []dns.RR
+
+	// attempt an incremental transfer if the client asked for IXFR and a
+	// journal is available
+	if rq.Question[0].Qtype == dns.TypeIXFR && zone.Journal != nil && len(rq.Ns) == 1 {
+		if clientSOA, ok := rq.Ns[0].(*dns.SOA); ok {
+			changes, _, ok, err := zone.Journal.Since(clientSOA.Serial)
+			if err == nil && ok {
+				rrs = buildIXFRRecords(zone, soa, changes)
+			}
+		}
+	}
+
+	// fall back to a full transfer (RFC 1995) when no incremental answer was
+	// built above
+	if rrs == nil {
+		if zone.Enumerate == nil {
+			s.refuseTransfer(w, rq)
+			return
+		}
+
+		sets, err := zone.Enumerate()
+		if err != nil {
+			s.reportError(rq, err.Error())
+			s.refuseTransfer(w, rq)
+			return
+		}
+
+		rrs = append(rrs, soa)
+
+		for _, set := range sets {
+			if set.Type.modern() {
+				rrs = append(rrs, set.convertModern(set.Name)...)
+			} else {
+				rrs = append(rrs, set.convert(zone, set.Name)...)
+			}
+		}
+
+		rrs = append(rrs, soa)
+	}
+
+	tr := new(dns.Transfer)
+
+	ch := make(chan *dns.Envelope, 1)
+	ch <- &dns.Envelope{RR: rrs}
+	close(ch)
+
+	err := tr.Out(w, rq, ch)
+	if err != nil {
+		s.reportError(rq, err.Error())
+		_ = w.Close()
+		return
+	}
+
+	_ = w.Close()
+}
+
+// buildIXFRRecords frames the RRsets of changes as an IXFR response per RFC
+// 1995: the envelope SOA, followed by each delta as the old SOA, its removed
+// RRsets, the new SOA, and its added RRsets, closed by the envelope SOA
+// again.
+func buildIXFRRecords(zone *Zone, envelope *dns.SOA, changes []Change) []dns.RR {
+	rrs := []dns.RR{envelope}
+
+	// per RFC 1995, each delta is delimited by the SOA it transitions from
+	// (before its deletions) and the SOA it transitions to (before its
+	// additions), so a secondary can tell adds from removes and reconstruct
+	// every delta
+	for _, change := range changes {
+		rrs = append(rrs, soaRecord(zone, change.OldSerial))
+
+		for _, set := range change.Removed {
+			if set.Type.modern() {
+				rrs = append(rrs, set.convertModern(set.Name)...)
+			} else {
+				rrs = append(rrs, set.convert(zone, set.Name)...)
+			}
+		}
+
+		rrs = append(rrs, soaRecord(zone, change.NewSerial))
+
+		for _, set := range change.Added {
+			if set.Type.modern() {
+				rrs = append(rrs, set.convertModern(set.Name)...)
+			} else {
+				rrs = append(rrs, set.convert(zone, set.Name)...)
+			}
+		}
+	}
+
+	rrs = append(rrs, envelope)
+
+	return rrs
+}
+
+// soaRecord builds the zone's SOA record with the given serial, used both
+// for the envelope SOA and the per-delta SOA markers in an IXFR response.
+func soaRecord(zone *Zone, serial uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone.Name,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    durationToTime(zone.SOATTL),
+		},
+		Ns:      zone.MasterNameServer,
+		Mbox:    emailToDomain(zone.AdminEmail),
+		Serial:  serial,
+		Refresh: durationToTime(zone.Refresh),
+		Retry:   durationToTime(zone.Retry),
+		Expire:  durationToTime(zone.Expire),
+		Minttl:  durationToTime(zone.MinTTL),
+	}
+}
+
+// refuseTransfer rejects an AXFR/IXFR request that is not authorized or not
+// supported by the zone.
+func (s *Server) refuseTransfer(w dns.ResponseWriter, rq *dns.Msg) {
+	rs := new(dns.Msg)
+	rs.SetReply(rq)
+	rs.Rcode = dns.RcodeRefused
+	_ = w.WriteMsg(rs)
+	_ = w.Close()
+}
@@ -0,0 +1,69 @@
+package newdns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestBuildIXFRRecordsDeltaFraming(t *testing.T) {
+	zone := &Zone{
+		Name:             "example.com.",
+		MasterNameServer: "ns1.example.com.",
+		AdminEmail:       "hostmaster@example.com.",
+	}
+
+	envelope := soaRecord(zone, 3)
+
+	changes := []Change{
+		{OldSerial: 1, NewSerial: 2},
+		{OldSerial: 2, NewSerial: 3},
+	}
+
+	rrs := buildIXFRRecords(zone, envelope, changes)
+
+	var serials []uint32
+	for _, rr := range rrs {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			t.Fatalf("expected every record to be a SOA, got %T", rr)
+		}
+
+		serials = append(serials, soa.Serial)
+	}
+
+	// envelope(3), delta1 old(1), delta1 new(2), delta2 old(2), delta2 new(3), envelope(3)
+	expected := []uint32{3, 1, 2, 2, 3, 3}
+
+	if len(serials) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %v", len(expected), len(serials), serials)
+	}
+
+	for i, serial := range serials {
+		if serial != expected[i] {
+			t.Errorf("record %d: expected serial %d, got %d", i, expected[i], serial)
+		}
+	}
+}
+
+func TestBuildIXFRRecordsNoChanges(t *testing.T) {
+	zone := &Zone{
+		Name:             "example.com.",
+		MasterNameServer: "ns1.example.com.",
+		AdminEmail:       "hostmaster@example.com.",
+	}
+
+	envelope := soaRecord(zone, 1)
+
+	rrs := buildIXFRRecords(zone, envelope, nil)
+
+	// an empty delta set still must be bracketed by the envelope SOA on
+	// both ends, per RFC 1995
+	if len(rrs) != 2 {
+		t.Fatalf("expected 2 envelope records, got %d", len(rrs))
+	}
+
+	if rrs[0].(*dns.SOA).Serial != 1 || rrs[1].(*dns.SOA).Serial != 1 {
+		t.Fatalf("expected both envelope records to carry serial 1, got %v", rrs)
+	}
+}
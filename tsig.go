@@ -0,0 +1,75 @@
+package newdns
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// verifyTSIG checks the TSIG status of an incoming request (already
+// validated by the underlying dns.Server against Config.TSIGSecrets) and, on
+// success, arranges for the reply to be signed with the same key.
+//
+// On failure, it sets the reply's rcode to REFUSED and attaches a TSIG
+// record reporting the specific error (BADKEY, BADSIG or BADTIME) per
+// RFC 2845 3.2, so the client learns why the request was rejected; the
+// caller writes the reply.
+//
+// It returns the verified key name (empty if the request was unsigned) and
+// whether the request is acceptable.
+func (s *Server) verifyTSIG(w dns.ResponseWriter, rq, rs *dns.Msg) (string, bool) {
+	tsig := rq.IsTsig()
+	if tsig == nil {
+		return "", true
+	}
+
+	if len(s.config.TSIGSecrets) == 0 {
+		s.refuseTSIG(rq, rs, tsig, dns.RcodeBadKey)
+		return "", false
+	}
+
+	err := w.TsigStatus()
+	if err != nil {
+		s.refuseTSIG(rq, rs, tsig, tsigErrorCode(err))
+		return "", false
+	}
+
+	// sign the reply with the same key and algorithm
+	rs.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+
+	return tsig.Hdr.Name, true
+}
+
+// refuseTSIG rejects the request, attaching an unsigned TSIG record that
+// carries tsigError (one of dns.RcodeBadKey/BadSig/BadTime) in its Error
+// field so the client knows specifically what failed.
+func (s *Server) refuseTSIG(rq, rs *dns.Msg, tsig *dns.TSIG, tsigError uint16) {
+	rs.Rcode = dns.RcodeRefused
+
+	rs.Extra = append(rs.Extra, &dns.TSIG{
+		Hdr: dns.RR_Header{
+			Name:   tsig.Hdr.Name,
+			Rrtype: dns.TypeTSIG,
+			Class:  dns.ClassANY,
+		},
+		Algorithm:  tsig.Algorithm,
+		TimeSigned: tsig.TimeSigned,
+		Fudge:      tsig.Fudge,
+		OrigId:     rq.Id,
+		Error:      tsigError,
+	})
+}
+
+// tsigErrorCode maps the error returned by dns.ResponseWriter.TsigStatus to
+// the TSIG extended error code (RFC 2845 2.3) that must be reported back in
+// the reply's TSIG record.
+func tsigErrorCode(err error) uint16 {
+	switch err {
+	case dns.ErrKeyAlg, dns.ErrKey, dns.ErrSecret:
+		return dns.RcodeBadKey
+	case dns.ErrTime:
+		return dns.RcodeBadTime
+	default:
+		return dns.RcodeBadSig
+	}
+}
@@ -0,0 +1,178 @@
+package newdns
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// probeTypes lists the record types checked when evaluating a prerequisite
+// that applies regardless of type (dns.TypeANY), since the zone has no
+// generic "does anything exist at this name" lookup. Also reused by
+// any.go's writeAnyFull to enumerate every type newdns understands.
+var probeTypes = []Type{TypeA, TypeAAAA, CNAME, MX, TXT, SVCB, HTTPS, CAA, TLSA, SSHFP}
+
+// handleUpdate answers an RFC 2136 dynamic update request: it validates the
+// zone section, checks all prerequisites, and if they hold, commits the
+// update section via Zone.Update.
+func (s *Server) handleUpdate(w dns.ResponseWriter, rq *dns.Msg) {
+	rs := new(dns.Msg)
+	rs.SetReply(rq)
+	rs.Authoritative = true
+
+	// verify tsig if present, refusing the request on failure
+	tsigKey, ok := s.verifyTSIG(w, rq, rs)
+	if !ok {
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	if len(rq.Question) != 1 {
+		rs.Rcode = dns.RcodeFormatError
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	zoneName := strings.ToLower(dns.Name(rq.Question[0].Name).String())
+
+	zone, err := s.config.Handler(zoneName)
+	if err != nil {
+		rs.Rcode = dns.RcodeServerFailure
+		s.reportError(rq, err.Error())
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	if zone == nil {
+		rs.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	// check authorization
+	if zone.RequireTSIGForUpdate && tsigKey == "" {
+		rs.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	if zone.AllowUpdate == nil || !zone.AllowUpdate(w.RemoteAddr(), tsigKey) {
+		rs.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	if zone.Update == nil {
+		rs.Rcode = dns.RcodeNotImplemented
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	// check prerequisites (rq.Answer carries the prerequisite section)
+	code := s.checkPrereqs(zone, rq.Answer)
+	if code != dns.RcodeSuccess {
+		rs.Rcode = code
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	// commit the update (rq.Ns carries the update section)
+	err = zone.Update(rq.Answer, rq.Ns)
+	if err != nil {
+		rs.Rcode = dns.RcodeServerFailure
+		s.reportError(rq, err.Error())
+		_ = w.WriteMsg(rs)
+		_ = w.Close()
+		return
+	}
+
+	_ = w.WriteMsg(rs)
+	_ = w.Close()
+}
+
+// checkPrereqs evaluates the RFC 2136 prerequisite section and returns the
+// rcode to reply with (NOERROR if all prerequisites are satisfied).
+func (s *Server) checkPrereqs(zone *Zone, prereqs []dns.RR) int {
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		name := strings.ToLower(dns.Name(hdr.Name).String())
+
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rrtype == dns.TypeANY {
+				// "name is in use"
+				if !s.nameInUse(zone, name) {
+					return dns.RcodeNameError
+				}
+
+				continue
+			}
+
+			// "RRset exists (value independent)"
+			result, _, err := zone.Lookup(name, Type(hdr.Rrtype))
+			if err != nil || len(result) == 0 {
+				return dns.RcodeNXRrset
+			}
+
+		case dns.ClassNONE:
+			if hdr.Rrtype == dns.TypeANY {
+				// "name is not in use"
+				if s.nameInUse(zone, name) {
+					return dns.RcodeYXDomain
+				}
+
+				continue
+			}
+
+			// "RRset does not exist"
+			result, _, err := zone.Lookup(name, Type(hdr.Rrtype))
+			if err == nil && len(result) > 0 {
+				return dns.RcodeYXRrset
+			}
+
+		case dns.ClassINET:
+			// "RRset exists (value dependent)"
+			result, _, err := zone.Lookup(name, Type(hdr.Rrtype))
+			if err != nil {
+				return dns.RcodeNXRrset
+			}
+
+			found := false
+
+			for _, res := range result {
+				for _, candidate := range res.Set.convert(zone, name) {
+					if dns.IsDuplicate(candidate, rr) {
+						found = true
+					}
+				}
+			}
+
+			if !found {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// nameInUse reports whether any RRset of a commonly probed type exists at
+// name.
+func (s *Server) nameInUse(zone *Zone, name string) bool {
+	for _, typ := range probeTypes {
+		result, avl, err := zone.Lookup(name, typ)
+		if err == nil && (len(result) > 0 || avl) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package newdns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// prereqTestZone builds a Zone whose Handler answers TypeA lookups for
+// "present.example.com." and nothing else, enough to exercise every branch
+// of checkPrereqs that does not depend on Set.convert's exact RR output.
+func prereqTestZone() *Zone {
+	return &Zone{
+		Name:             "example.com.",
+		MasterNameServer: "ns1.example.com.",
+		Handler: func(typ Type, name string) ([]Record, error) {
+			if name == "present.example.com." && typ == TypeA {
+				return []Record{{Address: "192.0.2.1"}}, nil
+			}
+
+			return nil, nil
+		},
+	}
+}
+
+func TestCheckPrereqsRcodeMapping(t *testing.T) {
+	s := &Server{config: Config{Handler: func(name string) (*Zone, error) { return nil, nil }}}
+	zone := prereqTestZone()
+
+	rrHeader := func(name string, rrtype uint16, class uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: class}
+	}
+
+	table := []struct {
+		name     string
+		prereqs  []dns.RR
+		expected int
+	}{
+		{
+			name:     "ANY/ANY name in use",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("present.example.com.", dns.TypeANY, dns.ClassANY)}},
+			expected: dns.RcodeSuccess,
+		},
+		{
+			name:     "ANY/ANY name not in use",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("absent.example.com.", dns.TypeANY, dns.ClassANY)}},
+			expected: dns.RcodeNameError,
+		},
+		{
+			name:     "ANY/A rrset exists",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("present.example.com.", dns.TypeA, dns.ClassANY)}},
+			expected: dns.RcodeSuccess,
+		},
+		{
+			name:     "ANY/A rrset missing",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("absent.example.com.", dns.TypeA, dns.ClassANY)}},
+			expected: dns.RcodeNXRrset,
+		},
+		{
+			name:     "NONE/ANY name not in use",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("absent.example.com.", dns.TypeANY, dns.ClassNONE)}},
+			expected: dns.RcodeSuccess,
+		},
+		{
+			name:     "NONE/ANY name in use",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("present.example.com.", dns.TypeANY, dns.ClassNONE)}},
+			expected: dns.RcodeYXDomain,
+		},
+		{
+			name:     "NONE/A rrset does not exist",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("absent.example.com.", dns.TypeA, dns.ClassNONE)}},
+			expected: dns.RcodeSuccess,
+		},
+		{
+			name:     "NONE/A rrset exists",
+			prereqs:  []dns.RR{&dns.ANY{Hdr: rrHeader("present.example.com.", dns.TypeA, dns.ClassNONE)}},
+			expected: dns.RcodeYXRrset,
+		},
+		{
+			name:     "INET/A rrset missing (value dependent)",
+			prereqs:  []dns.RR{&dns.A{Hdr: rrHeader("absent.example.com.", dns.TypeA, dns.ClassINET)}},
+			expected: dns.RcodeNXRrset,
+		},
+	}
+
+	for _, entry := range table {
+		t.Run(entry.name, func(t *testing.T) {
+			code := s.checkPrereqs(zone, entry.prereqs)
+			if code != entry.expected {
+				t.Errorf("checkPrereqs() = %s, expected %s", dns.RcodeToString[code], dns.RcodeToString[entry.expected])
+			}
+		})
+	}
+}
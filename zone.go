@@ -2,6 +2,7 @@ package newdns
 
 import (
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/miekg/dns"
@@ -57,6 +58,85 @@ type Zone struct {
 
 	// The handler that responds to requests for this zone.
 	Handler func(typ Type, name string) ([]Record, error)
+
+	// The extended handler that responds to requests for this zone with
+	// access to the EDNS0 Client Subnet carried by the request, allowing
+	// GeoDNS-style answers. If set, it takes precedence over Handler. The
+	// returned scope reports how specific the answer is (see Set.Scope) so
+	// the server can echo it back in the reply's client subnet option.
+	HandlerEx func(ctx LookupContext, typ Type, name string) (records []Record, scope uint8, err error)
+
+	// The DNSSEC signing keys used to sign responses for this zone. The list
+	// may contain both Key Signing Keys (KSK) and Zone Signing Keys (ZSK).
+	// If empty, responses are never signed regardless of the client's DO bit.
+	DNSSECKeys []DNSSECKey
+
+	// The denial of existence mechanism used for NXDOMAIN and NODATA
+	// responses.
+	//
+	// Default: DenialNSEC.
+	DenialOfExistence DenialMode
+
+	// The salt used for NSEC3 hashing, hex encoded. Only used if
+	// DenialOfExistence is DenialNSEC3.
+	NSEC3Salt string
+
+	// The number of additional hash iterations used for NSEC3 hashing. Only
+	// used if DenialOfExistence is DenialNSEC3.
+	//
+	// Default: 0.
+	NSEC3Iterations uint16
+
+	// The validity period of generated RRSIG records.
+	//
+	// Default: 7 * 24h.
+	SignatureValidity time.Duration
+
+	// The serial number of the zone, published in the SOA record and used by
+	// secondaries to decide whether to refresh.
+	//
+	// Default: 1.
+	Serial uint32
+
+	// AllowTransfer decides whether the requesting address may perform a
+	// zone transfer (AXFR/IXFR). If nil, transfers are refused.
+	AllowTransfer func(remoteAddr net.Addr) bool
+
+	// Enumerate returns all RRsets in the zone, used to serve AXFR requests
+	// and as the IXFR fallback when no Journal is configured.
+	Enumerate func() ([]Set, error)
+
+	// Journal optionally provides incremental zone history, allowing IXFR
+	// requests to be answered with only the changes since the requester's
+	// serial.
+	Journal Journal
+
+	// OnNotify is called when a NOTIFY (RFC 1996) is received from a
+	// primary, reporting the serial it carried. Implementations typically
+	// trigger a refresh (e.g. an IXFR/AXFR pull) from the sender.
+	OnNotify func(from net.Addr, serial uint32) error
+
+	// The addresses (host:port) of secondary name servers that should be
+	// notified via Server.Notify after the zone's data changes. Used as the
+	// default target list when Notify is called without explicit targets.
+	Secondaries []string
+
+	// RequireTSIGForTransfer rejects AXFR/IXFR requests that are not signed
+	// with a valid TSIG key.
+	RequireTSIGForTransfer bool
+
+	// RequireTSIGForUpdate rejects RFC 2136 dynamic updates that are not
+	// signed with a valid TSIG key.
+	RequireTSIGForUpdate bool
+
+	// AllowUpdate decides whether the requester may submit RFC 2136 dynamic
+	// updates for this zone. If nil, updates are refused.
+	AllowUpdate func(remote net.Addr, tsigKey string) bool
+
+	// Update commits a dynamic update once its prerequisites have been
+	// checked by the server, applying the given add/delete RRs to the
+	// zone's storage.
+	Update func(prereqs []dns.RR, updates []dns.RR) error
 }
 
 // Validate will validate the zone and ensure the documented defaults.
@@ -113,6 +193,21 @@ func (z *Zone) Validate() error {
 		z.MinTTL = 5 * time.Minute
 	}
 
+	// set default signature validity
+	if z.SignatureValidity == 0 {
+		z.SignatureValidity = 7 * 24 * time.Hour
+	}
+
+	// set default serial
+	if z.Serial == 0 {
+		z.Serial = 1
+	}
+
+	// check NSEC3 iterations
+	if z.DenialOfExistence == DenialNSEC3 && z.NSEC3Iterations > 2500 {
+		return fmt.Errorf("NSEC3 iterations must not exceed 2500")
+	}
+
 	// check retry
 	if z.Retry >= z.Refresh {
 		return fmt.Errorf("retry must be less than refresh")